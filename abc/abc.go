@@ -0,0 +1,148 @@
+// Package abc converts between the session.Tune model and ABC notation
+// text, in both directions: emitting ABC headers/body from a Tune, and
+// parsing one or more ABC tunes back out of a .abc file.
+package abc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/CormacC30/json-abc-converter/session"
+)
+
+// WriteTune writes tune to w as a standard ABC header block followed by
+// the tune body.
+func WriteTune(w io.Writer, tune session.Tune) error {
+	fmt.Fprintf(w, "X:%s\n", tune.SettingID)
+	fmt.Fprintf(w, "T:%s\n", tune.Name)
+	fmt.Fprintf(w, "R:%s\n", tune.Type)
+	fmt.Fprintf(w, "M:%s\n", tune.Meter)
+	fmt.Fprintf(w, "K:%s\n", ModeToABC(tune.Mode))
+	if tune.Username != "" {
+		fmt.Fprintf(w, "Z:%s\n", tune.Username)
+	}
+	if tune.Date != "" {
+		fmt.Fprintf(w, "H:Added %s\n", tune.Date)
+	}
+
+	fmt.Fprintln(w, tune.ABC)
+
+	return nil
+}
+
+// ModeToABC converts a session.Tune.Mode string like "Gmajor" or
+// "F#mixolydian" into its canonical ABC K: value ("G", "F#mix"), backed
+// by the Key type so the tonic's case and any accidental survive the
+// round trip. Inputs that don't parse as a Key are returned unchanged.
+func ModeToABC(mode string) string {
+	key, err := ParseKey(mode)
+	if err != nil {
+		return mode
+	}
+	return key.String()
+}
+
+// ModeFromABC is the inverse of ModeToABC: it expands an ABC key/mode
+// abbreviation (e.g. "Gm", "Edor", the legacy "d mix") back into the
+// JSON mode format used by session.Tune (e.g. "Gminor", "Edorian").
+func ModeFromABC(key string) string {
+	k, err := ParseABCKey(key)
+	if err != nil {
+		return key
+	}
+	return k.JSONMode()
+}
+
+// illegalFileNameChars are characters not allowed in output filenames.
+var illegalFileNameChars = []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|"}
+
+// SanitizeFileName removes characters that are not allowed in filenames and
+// shortens the result if needed.
+func SanitizeFileName(name string) string {
+	result := name
+	for _, char := range illegalFileNameChars {
+		result = strings.ReplaceAll(result, char, "_")
+	}
+
+	if len(result) > 50 {
+		result = result[:50]
+	}
+
+	return result
+}
+
+// headerField maps an ABC header letter to the Tune field it populates.
+var headerField = map[byte]func(t *session.Tune, value string){
+	'X': func(t *session.Tune, v string) { t.SettingID = v },
+	'T': func(t *session.Tune, v string) { t.Name = v },
+	'R': func(t *session.Tune, v string) { t.Type = v },
+	'M': func(t *session.Tune, v string) { t.Meter = v },
+	'K': func(t *session.Tune, v string) { t.Mode = ModeFromABC(v) },
+	'Z': func(t *session.Tune, v string) { t.Username = v },
+}
+
+const addedPrefix = "Added "
+
+// ParseFile splits data on "X:" tune headers and parses each section into
+// a session.Tune. Header fields are mapped back to struct fields
+// (X->SettingID, T->Name, R->Type, M->Meter, K->Mode, Z->Username,
+// H:Added <date>->Date); any remaining body lines are joined back into ABC.
+func ParseFile(data []byte) ([]session.Tune, error) {
+	var tunes []session.Tune
+	var tune *session.Tune
+	var body []string
+
+	flush := func() {
+		if tune == nil {
+			return
+		}
+		tune.ABC = strings.TrimRight(strings.Join(body, "\n"), "\n")
+		tunes = append(tunes, *tune)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "X:") {
+			flush()
+			tune = &session.Tune{}
+			body = nil
+		}
+
+		if tune == nil {
+			continue
+		}
+
+		if len(line) >= 2 && line[1] == ':' {
+			letter := line[0]
+			value := strings.TrimSpace(line[2:])
+
+			if letter == 'H' && strings.HasPrefix(value, addedPrefix) {
+				tune.Date = strings.TrimPrefix(value, addedPrefix)
+				continue
+			}
+
+			if set, ok := headerField[letter]; ok {
+				set(tune, value)
+				continue
+			}
+		}
+
+		if strings.TrimSpace(line) == "" && len(body) == 0 {
+			continue
+		}
+
+		body = append(body, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanning ABC file: %w", err)
+	}
+
+	flush()
+
+	return tunes, nil
+}
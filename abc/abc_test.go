@@ -0,0 +1,72 @@
+package abc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/CormacC30/json-abc-converter/session"
+)
+
+func TestModeRoundTrip(t *testing.T) {
+	cases := []string{
+		"Gmajor",
+		"Amajor",
+		"Eminor",
+		"Bbminor",
+		"Dmixolydian",
+		"Edorian",
+		"F#mixolydian",
+		"Cphrygian",
+		"Glydian",
+		"Blocrian",
+	}
+
+	for _, mode := range cases {
+		abcKey := ModeToABC(mode)
+		got := ModeFromABC(abcKey)
+		if got != mode {
+			t.Errorf("ModeFromABC(ModeToABC(%q)) = %q, want %q (intermediate %q)", mode, got, mode, abcKey)
+		}
+	}
+}
+
+func TestParseFileRoundTrip(t *testing.T) {
+	tunes := []session.Tune{
+		{
+			SettingID: "1",
+			Name:      "The Kesh Jig",
+			Type:      "jig",
+			Meter:     "6/8",
+			Mode:      "Gmajor",
+			Username:  "jeremy",
+			Date:      "2001-06-12",
+			ABC:       "|:D2D GAG|GAB d2B|d2B def|gfe dBA:|",
+		},
+		{
+			SettingID: "2",
+			Name:      "The Musical Priest",
+			Type:      "reel",
+			Meter:     "4/4",
+			Mode:      "Dmixolydian",
+			ABC:       "|:DB,D GBd|efe dBA|DB,D GBd|~g3 fed:|",
+		},
+	}
+
+	var buf bytes.Buffer
+	for _, tune := range tunes {
+		if err := WriteTune(&buf, tune); err != nil {
+			t.Fatalf("WriteTune: %v", err)
+		}
+		buf.WriteString("\n")
+	}
+
+	parsed, err := ParseFile(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+
+	if !reflect.DeepEqual(parsed, tunes) {
+		t.Errorf("round trip mismatch:\n got: %+v\nwant: %+v", parsed, tunes)
+	}
+}
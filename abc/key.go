@@ -0,0 +1,206 @@
+package abc
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ModeType identifies one of the seven diatonic modes a Key can carry.
+type ModeType int
+
+// The seven diatonic modes, ordered from brightest to darkest relative to
+// a major scale sharing the same tonic.
+const (
+	Lydian ModeType = iota
+	Major
+	Mixolydian
+	Dorian
+	Minor
+	Phrygian
+	Locrian
+)
+
+// jsonName is the lowercase mode word used in the session.Tune.Mode
+// string, e.g. "Gmajor", "Bbminor".
+var jsonName = map[ModeType]string{
+	Lydian:     "lydian",
+	Major:      "major",
+	Mixolydian: "mixolydian",
+	Dorian:     "dorian",
+	Minor:      "minor",
+	Phrygian:   "phrygian",
+	Locrian:    "locrian",
+}
+
+// abcSuffix is the canonical ABC 2.1 mode suffix appended after the tonic
+// and accidental. Major has no suffix at all.
+var abcSuffix = map[ModeType]string{
+	Lydian:     "lyd",
+	Major:      "",
+	Mixolydian: "mix",
+	Dorian:     "dor",
+	Minor:      "m",
+	Phrygian:   "phr",
+	Locrian:    "loc",
+}
+
+// fifthsOffset is how many positions around the circle of fifths a mode
+// sits from the major scale of the same tonic, e.g. G Mixolydian shares
+// C major's key signature (one fewer sharp than G major).
+var fifthsOffset = map[ModeType]int{
+	Lydian:     1,
+	Major:      0,
+	Mixolydian: -1,
+	Dorian:     -2,
+	Minor:      -3,
+	Phrygian:   -4,
+	Locrian:    -5,
+}
+
+// modeByWord maps every accepted spelling (full name or ABC abbreviation)
+// to its ModeType, case-insensitive.
+var modeByWord = map[string]ModeType{
+	"":           Major,
+	"maj":        Major,
+	"major":      Major,
+	"m":          Minor,
+	"min":        Minor,
+	"minor":      Minor,
+	"dor":        Dorian,
+	"dorian":     Dorian,
+	"phr":        Phrygian,
+	"phrygian":   Phrygian,
+	"lyd":        Lydian,
+	"lydian":     Lydian,
+	"mix":        Mixolydian,
+	"mixolydian": Mixolydian,
+	"loc":        Locrian,
+	"locrian":    Locrian,
+}
+
+// Key is a parsed ABC key signature: a tonic letter, an optional
+// accidental on that tonic, and a mode.
+type Key struct {
+	Tonic      rune   // 'A'-'G'
+	Accidental string // "", "#" or "b"
+	Mode       ModeType
+}
+
+// tonicFifths is each natural tonic's position on the circle of fifths
+// relative to C (sharps positive, flats negative).
+var tonicFifths = map[rune]int{
+	'C': 0, 'G': 1, 'D': 2, 'A': 3, 'E': 4, 'B': 5, 'F': -1,
+}
+
+var sharpOrder = []string{"F#", "C#", "G#", "D#", "A#", "E#", "B#"}
+var flatOrder = []string{"Bb", "Eb", "Ab", "Db", "Gb", "Cb", "Fb"}
+
+// ParseKey parses a session.Tune.Mode-style string such as "Gmajor",
+// "Edorian", "Bbminor" or "F#mixolydian" into a Key.
+func ParseKey(s string) (Key, error) {
+	if s == "" {
+		return Key{}, fmt.Errorf("abc: empty key")
+	}
+
+	tonic := unicode.ToUpper(rune(s[0]))
+	if tonic < 'A' || tonic > 'G' {
+		return Key{}, fmt.Errorf("abc: invalid tonic in key %q", s)
+	}
+
+	rest := s[1:]
+	accidental := ""
+	switch {
+	case strings.HasPrefix(rest, "#"):
+		accidental = "#"
+		rest = rest[1:]
+	case strings.HasPrefix(rest, "b"):
+		accidental = "b"
+		rest = rest[1:]
+	}
+
+	mode, ok := modeByWord[strings.ToLower(rest)]
+	if !ok {
+		return Key{}, fmt.Errorf("abc: unknown mode in key %q", s)
+	}
+
+	return Key{Tonic: tonic, Accidental: accidental, Mode: mode}, nil
+}
+
+// ParseABCKey parses an ABC K: header value such as "G", "Edor", "Bbm" or
+// "F#Mix" into a Key. It also accepts the looser, space-separated forms
+// ("D mix", "e dor") that older versions of this converter emitted.
+func ParseABCKey(s string) (Key, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Key{}, fmt.Errorf("abc: empty key")
+	}
+
+	tonic := unicode.ToUpper(rune(s[0]))
+	if tonic < 'A' || tonic > 'G' {
+		return Key{}, fmt.Errorf("abc: invalid tonic in key %q", s)
+	}
+
+	rest := s[1:]
+	accidental := ""
+	switch {
+	case strings.HasPrefix(rest, "#"):
+		accidental = "#"
+		rest = rest[1:]
+	case strings.HasPrefix(rest, "b"):
+		accidental = "b"
+		rest = rest[1:]
+	}
+
+	mode, ok := modeByWord[strings.ToLower(strings.TrimSpace(rest))]
+	if !ok {
+		return Key{}, fmt.Errorf("abc: unknown mode in key %q", s)
+	}
+
+	return Key{Tonic: tonic, Accidental: accidental, Mode: mode}, nil
+}
+
+// String renders the Key canonically per ABC 2.1: a bare tonic letter for
+// major ("G"), an "m" suffix for minor ("Bbm"), and a three-letter suffix
+// for the remaining modes ("Edor", "F#mix").
+func (k Key) String() string {
+	return fmt.Sprintf("%c%s%s", k.Tonic, k.Accidental, abcSuffix[k.Mode])
+}
+
+// JSONMode renders the Key in the session.Tune.Mode format, e.g.
+// "Bbminor", "F#mixolydian".
+func (k Key) JSONMode() string {
+	return fmt.Sprintf("%c%s%s", k.Tonic, k.Accidental, jsonName[k.Mode])
+}
+
+// fifths returns k's position on the circle of fifths: positive values
+// count sharps, negative values count flats.
+func (k Key) fifths() int {
+	v := tonicFifths[k.Tonic]
+	switch k.Accidental {
+	case "#":
+		v += 7
+	case "b":
+		v -= 7
+	}
+	return v + fifthsOffset[k.Mode]
+}
+
+// Signature returns k's key signature as an ordered list of accidentals,
+// e.g. []string{"F#", "C#"} for D major or []string{"Bb", "Eb"} for
+// B-flat major. It is empty for keys with no sharps or flats.
+func (k Key) Signature() []string {
+	n := k.fifths()
+	if n >= 0 {
+		if n > len(sharpOrder) {
+			n = len(sharpOrder)
+		}
+		return append([]string(nil), sharpOrder[:n]...)
+	}
+
+	n = -n
+	if n > len(flatOrder) {
+		n = len(flatOrder)
+	}
+	return append([]string(nil), flatOrder[:n]...)
+}
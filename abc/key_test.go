@@ -0,0 +1,74 @@
+package abc
+
+import "testing"
+
+func TestKeyRoundTrip(t *testing.T) {
+	tonics := []string{"C", "G", "D", "A", "E", "B", "F#", "Db", "Ab", "Eb", "Bb", "F"}
+	modes := []string{"major", "minor", "dorian", "phrygian", "lydian", "mixolydian", "locrian"}
+
+	for _, tonic := range tonics {
+		for _, mode := range modes {
+			jsonMode := tonic + mode
+
+			key, err := ParseKey(jsonMode)
+			if err != nil {
+				t.Fatalf("ParseKey(%q): %v", jsonMode, err)
+			}
+
+			abcKey, err := ParseABCKey(key.String())
+			if err != nil {
+				t.Fatalf("ParseABCKey(%q): %v", key.String(), err)
+			}
+			if abcKey != key {
+				t.Errorf("ParseABCKey(%q) = %+v, want %+v", key.String(), abcKey, key)
+			}
+			if got := abcKey.JSONMode(); got != jsonMode {
+				t.Errorf("JSONMode() = %q, want %q", got, jsonMode)
+			}
+		}
+	}
+}
+
+func TestKeySignature(t *testing.T) {
+	cases := []struct {
+		mode string
+		want []string
+	}{
+		{"Cmajor", nil},
+		{"Amajor", []string{"F#", "C#", "G#"}},
+		{"Fmajor", []string{"Bb"}},
+		{"Dmixolydian", []string{"F#"}},   // shares G major's key signature
+		{"Edorian", []string{"F#", "C#"}}, // shares D major's key signature
+		{"Bbmajor", []string{"Bb", "Eb"}},
+	}
+
+	for _, c := range cases {
+		key, err := ParseKey(c.mode)
+		if err != nil {
+			t.Fatalf("ParseKey(%q): %v", c.mode, err)
+		}
+
+		got := key.Signature()
+		if len(got) != len(c.want) {
+			t.Fatalf("Signature(%q) = %v, want %v", c.mode, got, c.want)
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("Signature(%q) = %v, want %v", c.mode, got, c.want)
+			}
+		}
+	}
+}
+
+func TestModeToABCPreservesTonicCase(t *testing.T) {
+	cases := map[string]string{
+		"Amajor":       "A",
+		"Bbminor":      "Bbm",
+		"F#mixolydian": "F#mix",
+	}
+	for mode, want := range cases {
+		if got := ModeToABC(mode); got != want {
+			t.Errorf("ModeToABC(%q) = %q, want %q", mode, got, want)
+		}
+	}
+}
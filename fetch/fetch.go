@@ -0,0 +1,354 @@
+// Package fetch pulls tunes directly from the thesession.org search API,
+// normalizing its response shape into session.Tune records. It is polite
+// to the upstream by default: requests are rate limited, retried with
+// exponential backoff on transient failures, and cached to disk using
+// standard ETag/If-Modified-Since validation.
+package fetch
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CormacC30/json-abc-converter/session"
+)
+
+const (
+	defaultBaseURL     = "https://thesession.org"
+	defaultMinInterval = time.Second
+	maxRetries         = 5
+	initialBackoff     = 500 * time.Millisecond
+)
+
+// Params maps the search filters a caller can apply to the API request.
+type Params struct {
+	Query string // free-text search, sent as "q"
+	Type  string // tune type, e.g. "reel"
+	Key   string // key/mode, e.g. "Gmajor"
+	Meter string // e.g. "4/4"
+}
+
+func (p Params) values(page int) url.Values {
+	v := url.Values{}
+	v.Set("format", "json")
+	v.Set("page", strconv.Itoa(page))
+	if p.Query != "" {
+		v.Set("q", p.Query)
+	}
+	if p.Type != "" {
+		v.Set("type", p.Type)
+	}
+	if p.Key != "" {
+		v.Set("key", p.Key)
+	}
+	if p.Meter != "" {
+		v.Set("meter", p.Meter)
+	}
+	return v
+}
+
+// Client fetches and caches tunes from the thesession.org API.
+type Client struct {
+	HTTP        *http.Client
+	BaseURL     string
+	CacheDir    string        // if set, responses are cached here and revalidated via ETag
+	MinInterval time.Duration // minimum spacing between requests
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// NewClient returns a Client with sensible defaults: a 1 req/sec rate
+// limit and caching under cacheDir (pass "" to disable caching).
+func NewClient(cacheDir string) *Client {
+	return &Client{
+		HTTP:        http.DefaultClient,
+		BaseURL:     defaultBaseURL,
+		CacheDir:    cacheDir,
+		MinInterval: defaultMinInterval,
+	}
+}
+
+// DefaultCacheDir returns ~/.cache/json-abc-converter, or "" if the user's
+// cache directory can't be determined.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "json-abc-converter")
+}
+
+// searchResponse is the shape of a thesession.org /tunes/search?format=json
+// page.
+type searchResponse struct {
+	Pages int       `json:"pages"`
+	Page  int       `json:"page"`
+	Tunes []apiTune `json:"tunes"`
+}
+
+// apiTune is one tune entry in the search response, holding one or more
+// settings (distinct recorded versions of the tune).
+type apiTune struct {
+	ID       int          `json:"id"`
+	Name     string       `json:"name"`
+	Type     string       `json:"type"`
+	Settings []apiSetting `json:"settings"`
+}
+
+type apiSetting struct {
+	ID     int    `json:"id"`
+	Key    string `json:"key"`
+	Meter  string `json:"meter"`
+	ABC    string `json:"abc"`
+	Date   string `json:"date"`
+	Member string `json:"member"`
+}
+
+// Search pages through the API for tunes matching p, calling out once per
+// setting in the order returned. It stops at the last page the API
+// reports, or when ctx is canceled.
+func (c *Client) Search(ctx context.Context, p Params, out func(session.Tune) error) error {
+	for page := 1; ; page++ {
+		resp, err := c.fetchPage(ctx, p, page)
+		if err != nil {
+			return fmt.Errorf("fetching page %d: %w", page, err)
+		}
+
+		for _, t := range resp.Tunes {
+			for _, tune := range normalize(t) {
+				if err := out(tune); err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(resp.Tunes) == 0 || page >= resp.Pages {
+			return nil
+		}
+	}
+}
+
+// normalize maps the API's tune/settings shape onto one session.Tune per
+// setting, since a Tune in our model is really one recorded setting.
+func normalize(t apiTune) []session.Tune {
+	tunes := make([]session.Tune, 0, len(t.Settings))
+	for _, s := range t.Settings {
+		tunes = append(tunes, session.Tune{
+			TuneID:    strconv.Itoa(t.ID),
+			SettingID: strconv.Itoa(s.ID),
+			Name:      t.Name,
+			Type:      t.Type,
+			Meter:     s.Meter,
+			Mode:      s.Key,
+			ABC:       s.ABC,
+			Date:      s.Date,
+			Username:  s.Member,
+		})
+	}
+	return tunes
+}
+
+func (c *Client) fetchPage(ctx context.Context, p Params, page int) (*searchResponse, error) {
+	reqURL := c.baseURL() + "/tunes/search?" + p.values(page).Encode()
+
+	body, err := c.getWithCache(ctx, reqURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var result searchResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	return &result, nil
+}
+
+func (c *Client) baseURL() string {
+	if c.BaseURL != "" {
+		return c.BaseURL
+	}
+	return defaultBaseURL
+}
+
+// getWithCache fetches reqURL, honoring and updating the on-disk
+// ETag/Last-Modified cache, and retries transient failures with backoff.
+func (c *Client) getWithCache(ctx context.Context, reqURL string) ([]byte, error) {
+	key := cacheKey(reqURL)
+	meta, cached := c.readCache(key)
+
+	var body []byte
+	err := withRetry(ctx, func() error {
+		c.throttle(ctx)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+		if err != nil {
+			return permanentError{err}
+		}
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+
+		resp, err := c.http().Do(req)
+		if err != nil {
+			return err // network errors are retryable
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusNotModified:
+			body = cached
+			return nil
+		case resp.StatusCode >= 500:
+			return fmt.Errorf("server error: %s", resp.Status)
+		case resp.StatusCode != http.StatusOK:
+			return permanentError{fmt.Errorf("unexpected status: %s", resp.Status)}
+		}
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		body = data
+
+		c.writeCache(key, cacheMeta{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		}, data)
+		return nil
+	})
+
+	return body, err
+}
+
+func (c *Client) http() *http.Client {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+	return http.DefaultClient
+}
+
+// throttle blocks until at least MinInterval has passed since the last
+// request, keeping the client to its configured rate limit. MinInterval
+// <= 0 disables throttling entirely; NewClient sets a 1 req/sec default,
+// so callers that want no rate limit (e.g. tests) must set it explicitly.
+func (c *Client) throttle(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.MinInterval <= 0 {
+		c.last = time.Now()
+		return
+	}
+
+	if wait := c.MinInterval - time.Since(c.last); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+	c.last = time.Now()
+}
+
+// permanentError marks an error as not worth retrying (e.g. a 4xx
+// response or a malformed request).
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// withRetry calls fn, retrying transient failures with exponential
+// backoff up to maxRetries times. Errors wrapped in permanentError are
+// returned immediately without retrying.
+func withRetry(ctx context.Context, fn func() error) error {
+	backoff := initialBackoff
+	var lastErr error
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		lastErr = err
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", maxRetries, lastErr)
+}
+
+// cacheMeta is the validator metadata stored alongside a cached response
+// body.
+type cacheMeta struct {
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+}
+
+func cacheKey(reqURL string) string {
+	sum := sha1.Sum([]byte(reqURL))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Client) readCache(key string) (cacheMeta, []byte) {
+	if c.CacheDir == "" {
+		return cacheMeta{}, nil
+	}
+
+	metaBytes, err := os.ReadFile(filepath.Join(c.CacheDir, key+".meta.json"))
+	if err != nil {
+		return cacheMeta{}, nil
+	}
+	var meta cacheMeta
+	if err := json.Unmarshal(metaBytes, &meta); err != nil {
+		return cacheMeta{}, nil
+	}
+
+	body, err := os.ReadFile(filepath.Join(c.CacheDir, key+".body.json"))
+	if err != nil {
+		return cacheMeta{}, nil
+	}
+
+	return meta, body
+}
+
+func (c *Client) writeCache(key string, meta cacheMeta, body []byte) {
+	if c.CacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(c.CacheDir, 0755); err != nil {
+		return
+	}
+
+	if metaBytes, err := json.Marshal(meta); err == nil {
+		_ = os.WriteFile(filepath.Join(c.CacheDir, key+".meta.json"), metaBytes, 0644)
+	}
+	_ = os.WriteFile(filepath.Join(c.CacheDir, key+".body.json"), body, 0644)
+}
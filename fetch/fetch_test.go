@@ -0,0 +1,130 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CormacC30/json-abc-converter/session"
+)
+
+func TestSearchPagesAndNormalizes(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		page := r.URL.Query().Get("page")
+
+		w.Header().Set("Content-Type", "application/json")
+		switch page {
+		case "1":
+			fmt.Fprint(w, `{"pages":2,"page":1,"tunes":[
+				{"id":1,"name":"The Kesh","type":"jig","settings":[
+					{"id":10,"key":"Gmajor","meter":"6/8","abc":"abc-1","date":"2020-01-01","member":"alice"}
+				]}
+			]}`)
+		case "2":
+			fmt.Fprint(w, `{"pages":2,"page":2,"tunes":[
+				{"id":2,"name":"Musical Priest","type":"reel","settings":[
+					{"id":20,"key":"Dmajor","meter":"4/4","abc":"abc-2","date":"2021-02-02","member":"bob"}
+				]}
+			]}`)
+		default:
+			t.Fatalf("unexpected page %q", page)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient("")
+	c.BaseURL = server.URL
+	c.MinInterval = 0
+
+	var got []session.Tune
+	err := c.Search(context.Background(), Params{Type: "jig"}, func(tune session.Tune) error {
+		got = append(got, tune)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d tunes, want 2", len(got))
+	}
+	if got[0].SettingID != "10" || got[0].Mode != "Gmajor" {
+		t.Errorf("unexpected first tune: %+v", got[0])
+	}
+	if got[1].SettingID != "20" || got[1].Username != "bob" {
+		t.Errorf("unexpected second tune: %+v", got[1])
+	}
+	if requests != 2 {
+		t.Errorf("made %d requests, want 2", requests)
+	}
+}
+
+func TestGetWithCacheRevalidates(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `{"pages":1,"page":1,"tunes":[]}`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	c := NewClient(dir)
+	c.BaseURL = server.URL
+	c.MinInterval = 0
+
+	if err := c.Search(context.Background(), Params{}, func(session.Tune) error { return nil }); err != nil {
+		t.Fatalf("first Search: %v", err)
+	}
+	if err := c.Search(context.Background(), Params{}, func(session.Tune) error { return nil }); err != nil {
+		t.Fatalf("second Search: %v", err)
+	}
+
+	if requests != 2 {
+		t.Fatalf("made %d requests, want 2 (both should hit the server, the second revalidating)", requests)
+	}
+}
+
+func TestWithRetryGivesUpOnPermanentError(t *testing.T) {
+	calls := 0
+	err := withRetry(context.Background(), func() error {
+		calls++
+		return permanentError{fmt.Errorf("nope")}
+	})
+	if err == nil || err.Error() != "nope" {
+		t.Fatalf("err = %v, want \"nope\"", err)
+	}
+	if calls != 1 {
+		t.Fatalf("calls = %d, want 1 (permanent errors should not retry)", calls)
+	}
+}
+
+func TestWithRetryRetriesTransientErrors(t *testing.T) {
+	calls := 0
+	start := time.Now()
+	err := withRetry(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("transient")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	if calls != 3 {
+		t.Fatalf("calls = %d, want 3", calls)
+	}
+	if time.Since(start) < initialBackoff {
+		t.Fatalf("retried without backing off")
+	}
+}
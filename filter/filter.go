@@ -0,0 +1,104 @@
+// Package filter implements a small boolean expression language for
+// selecting session.Tune records, e.g.
+//
+//	type=reel AND meter=4/4 AND mode~=dorian
+//
+// letting callers extract a subset of a tune collection (say, "all
+// G-major jigs added after 2020") without pre-processing the JSON with an
+// external tool.
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/CormacC30/json-abc-converter/session"
+)
+
+// Expr is a parsed filter expression that can be evaluated against a tune.
+type Expr interface {
+	Eval(tune session.Tune) bool
+}
+
+// Parse compiles a filter expression into an Expr.
+func Parse(src string) (Expr, error) {
+	p := &parser{tokens: lex(src), src: src}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("filter: unexpected %q after expression", p.peek().text)
+	}
+	return expr, nil
+}
+
+// field looks up the string value of a named Tune field, case-insensitive
+// and matching the JSON field names used in session.Tune.
+var field = map[string]func(session.Tune) string{
+	"tune_id":    func(t session.Tune) string { return t.TuneID },
+	"setting_id": func(t session.Tune) string { return t.SettingID },
+	"name":       func(t session.Tune) string { return t.Name },
+	"type":       func(t session.Tune) string { return t.Type },
+	"meter":      func(t session.Tune) string { return t.Meter },
+	"mode":       func(t session.Tune) string { return t.Mode },
+	"abc":        func(t session.Tune) string { return t.ABC },
+	"date":       func(t session.Tune) string { return t.Date },
+	"username":   func(t session.Tune) string { return t.Username },
+}
+
+// andExpr is true when both operands are true.
+type andExpr struct{ left, right Expr }
+
+func (e andExpr) Eval(t session.Tune) bool { return e.left.Eval(t) && e.right.Eval(t) }
+
+// orExpr is true when either operand is true.
+type orExpr struct{ left, right Expr }
+
+func (e orExpr) Eval(t session.Tune) bool { return e.left.Eval(t) || e.right.Eval(t) }
+
+// notExpr negates its operand.
+type notExpr struct{ inner Expr }
+
+func (e notExpr) Eval(t session.Tune) bool { return !e.inner.Eval(t) }
+
+// cmpExpr compares a single field against a value using "=", "!=" or the
+// case-insensitive substring operator "~=".
+type cmpExpr struct {
+	get   func(session.Tune) string
+	op    string
+	value string
+}
+
+func (e cmpExpr) Eval(t session.Tune) bool {
+	got := strings.ToLower(e.get(t))
+	want := strings.ToLower(e.value)
+
+	switch e.op {
+	case "=":
+		return got == want
+	case "!=":
+		return got != want
+	case "~=":
+		return strings.Contains(got, want)
+	default:
+		return false
+	}
+}
+
+// inExpr is true when the field's value matches any member of values,
+// case-insensitive.
+type inExpr struct {
+	get    func(session.Tune) string
+	values []string
+}
+
+func (e inExpr) Eval(t session.Tune) bool {
+	got := strings.ToLower(e.get(t))
+	for _, v := range e.values {
+		if got == strings.ToLower(v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/CormacC30/json-abc-converter/session"
+)
+
+func TestEval(t *testing.T) {
+	tune := session.Tune{
+		SettingID: "1",
+		Name:      "The Kesh Jig",
+		Type:      "jig",
+		Meter:     "6/8",
+		Mode:      "Gmajor",
+		Date:      "2021-03-01",
+	}
+
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{"type=reel", false},
+		{"type=jig", true},
+		{"type=JIG", true},
+		{"TYPE=jig", true},
+		{"type!=reel", true},
+		{"mode~=major", true},
+		{"mode~=dorian", false},
+		{"type=reel AND meter=4/4", false},
+		{"type=jig AND meter=6/8", true},
+		{"type=reel OR meter=6/8", true},
+		{"NOT type=reel", true},
+		{"type IN (reel, jig, hornpipe)", true},
+		{"type IN (reel, hornpipe)", false},
+		{"(type=reel OR type=jig) AND mode~=major", true},
+	}
+
+	for _, c := range cases {
+		expr, err := Parse(c.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", c.expr, err)
+		}
+		if got := expr.Eval(tune); got != c.want {
+			t.Errorf("Parse(%q).Eval(tune) = %v, want %v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []string{
+		"",
+		"type=",
+		"nope=reel",
+		"type=reel AND",
+		"(type=reel",
+		"type=reel)",
+		"type IN reel",
+		"type~dorian",
+		"type!jig",
+	}
+
+	for _, expr := range cases {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): expected an error, got nil", expr)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package filter
+
+import "strings"
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokEq     // =
+	tokNeq    // !=
+	tokMatch  // ~=
+	tokLParen // (
+	tokRParen // )
+	tokComma  // ,
+	tokAnd
+	tokOr
+	tokNot
+	tokIn
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+var keywords = map[string]tokenKind{
+	"and": tokAnd,
+	"or":  tokOr,
+	"not": tokNot,
+	"in":  tokIn,
+}
+
+// lex tokenizes a filter expression. It never returns an error; malformed
+// input surfaces as an unexpected token during parsing.
+func lex(src string) []token {
+	var tokens []token
+	runes := []rune(src)
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")"})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ","})
+			i++
+		case c == '!' && i+1 < len(runes) && runes[i+1] == '=':
+			tokens = append(tokens, token{tokNeq, "!="})
+			i += 2
+		case c == '~' && i+1 < len(runes) && runes[i+1] == '=':
+			tokens = append(tokens, token{tokMatch, "~="})
+			i += 2
+		case c == '=':
+			tokens = append(tokens, token{tokEq, "="})
+			i++
+		case c == '!' || c == '~':
+			// A lone '!' or '~' not forming "!=" / "~=": not a valid
+			// operator, but still a single rune so the scan keeps moving.
+			// Surfaces as an "unexpected operator" parse error instead of
+			// being silently absorbed into the next word.
+			tokens = append(tokens, token{tokIdent, string(c)})
+			i++
+		case c == '\'' || c == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != c {
+				j++
+			}
+			tokens = append(tokens, token{tokString, string(runes[i+1 : j])})
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !strings.ContainsRune(" \t\n\r()=,!~", runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			if kind, ok := keywords[strings.ToLower(word)]; ok {
+				tokens = append(tokens, token{kind, word})
+			} else {
+				tokens = append(tokens, token{tokIdent, word})
+			}
+			i = j
+		}
+	}
+
+	tokens = append(tokens, token{tokEOF, ""})
+	return tokens
+}
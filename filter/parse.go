@@ -0,0 +1,140 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parser is a hand-written recursive-descent parser over the token
+// stream produced by lex. Precedence, loosest first: OR, AND, NOT,
+// comparison.
+type parser struct {
+	tokens []token
+	pos    int
+	src    string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if p.pos < len(p.tokens)-1 {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	if p.peek().kind == tokLParen {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, fmt.Errorf("filter: expected ')', got %q", p.peek().text)
+		}
+		p.next()
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	name := p.next()
+	if name.kind != tokIdent {
+		return nil, fmt.Errorf("filter: expected a field name, got %q", name.text)
+	}
+
+	get, ok := field[strings.ToLower(name.text)]
+	if !ok {
+		return nil, fmt.Errorf("filter: unknown field %q", name.text)
+	}
+
+	op := p.next()
+	switch op.kind {
+	case tokEq, tokNeq, tokMatch:
+		value := p.next()
+		if value.kind != tokIdent && value.kind != tokString {
+			return nil, fmt.Errorf("filter: expected a value after %q, got %q", op.text, value.text)
+		}
+		return cmpExpr{get: get, op: op.text, value: value.text}, nil
+
+	case tokIn:
+		if p.peek().kind != tokLParen {
+			return nil, fmt.Errorf("filter: expected '(' after IN, got %q", p.peek().text)
+		}
+		p.next()
+
+		var values []string
+		for {
+			value := p.next()
+			if value.kind != tokIdent && value.kind != tokString {
+				return nil, fmt.Errorf("filter: expected a value in IN list, got %q", value.text)
+			}
+			values = append(values, value.text)
+
+			if p.peek().kind == tokComma {
+				p.next()
+				continue
+			}
+			break
+		}
+
+		if p.peek().kind != tokRParen {
+			return nil, fmt.Errorf("filter: expected ')' to close IN list, got %q", p.peek().text)
+		}
+		p.next()
+
+		return inExpr{get: get, values: values}, nil
+
+	default:
+		return nil, fmt.Errorf("filter: expected an operator after %q, got %q", name.text, op.text)
+	}
+}
@@ -1,191 +1,234 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strings"
-)
+	"syscall"
 
-// Tune represents the structure of each tune in the JSON file
-type Tune struct {
-	TuneID    string `json:"tune_id"`
-	SettingID string `json:"setting_id"`
-	Name      string `json:"name"`
-	Type      string `json:"type"`
-	Meter     string `json:"meter"`
-	Mode      string `json:"mode"`
-	ABC       string `json:"abc"`
-	Date      string `json:"date,omitempty"`
-	Username  string `json:"username,omitempty"`
-}
+	"github.com/CormacC30/json-abc-converter/abc"
+	"github.com/CormacC30/json-abc-converter/fetch"
+	"github.com/CormacC30/json-abc-converter/filter"
+	"github.com/CormacC30/json-abc-converter/pipeline"
+	"github.com/CormacC30/json-abc-converter/session"
+)
 
 func main() {
-	inputFile := flag.String("input", "", "Path to the input JSON file")
-	outputDir := flag.String("output", ".", "Directory for output ABC files")
+	inputFile := flag.String("input", "", "Path to the input JSON file (or, with -reverse, a single .abc file)")
+	outputDir := flag.String("output", ".", "Directory for output files")
 	singleFile := flag.Bool("single", false, "Output to a single file instead of multiple files")
 	singleFilePath := flag.String("outfile", "all_tunes.abc", "Name of the single output file (used with -single)")
+	workers := flag.Int("workers", runtime.NumCPU(), "Number of concurrent writer goroutines")
+	reverse := flag.Bool("reverse", false, "Reverse mode: read .abc file(s) and reconstruct a JSON array of tunes")
+	jsonOut := flag.String("jsonout", "tunes.json", "Name of the JSON file to write (used with -reverse)")
+	fetchMode := flag.Bool("fetch", false, "Fetch tunes directly from the thesession.org API instead of reading a local file")
+	query := flag.String("query", "", "Free-text search query (used with -fetch)")
+	tuneType := flag.String("type", "", "Tune type filter, e.g. reel (used with -fetch)")
+	key := flag.String("key", "", "Key/mode filter, e.g. Gmajor (used with -fetch)")
+	meter := flag.String("meter", "", "Meter filter, e.g. 4/4 (used with -fetch)")
+	filterExpr := flag.String("filter", "", `Expression to select tunes before writing, e.g. "type=reel AND meter=4/4 AND mode~=dorian"`)
+	sortBy := flag.String("sort", "", "Sort tunes before writing: "+strings.Join(pipeline.SortKeys, "|"))
+	limit := flag.Int("limit", 0, "Write at most this many tunes (after -filter and -sort)")
 	flag.Parse()
 
-	if *inputFile == "" {
-		fmt.Println("Please provide an input file with the -input flag")
-		flag.PrintDefaults()
+	var filterOpt filter.Expr
+	if *filterExpr != "" {
+		expr, err := filter.Parse(*filterExpr)
+		if err != nil {
+			fmt.Printf("Error parsing -filter: %v\n", err)
+			os.Exit(1)
+		}
+		filterOpt = expr
+	}
+	if *sortBy != "" && !validSortKey(*sortBy) {
+		fmt.Printf("Error: -sort must be one of %s\n", strings.Join(pipeline.SortKeys, ", "))
 		os.Exit(1)
 	}
 
-	// Read the input file
-	data, err := ioutil.ReadFile(*inputFile)
-	if err != nil {
-		fmt.Printf("Error reading file: %v\n", err)
-		os.Exit(1)
+	if *reverse {
+		runReverse(*inputFile, flag.Args(), *outputDir, *jsonOut)
+		return
 	}
 
-	// Parse the JSON data
-	var tunes []Tune
-	err = json.Unmarshal(data, &tunes)
-	if err != nil {
-		fmt.Printf("Error parsing JSON: %v\n", err)
-		os.Exit(1)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *fetchMode {
+		runFetch(ctx, *outputDir, *singleFile, *singleFilePath, *workers, fetch.Params{
+			Query: *query,
+			Type:  *tuneType,
+			Key:   *key,
+			Meter: *meter,
+		}, filterOpt, *sortBy, *limit)
+		return
 	}
 
-	fmt.Printf("Found %d tunes in the input file\n", len(tunes))
+	runForward(ctx, *inputFile, *outputDir, *singleFile, *singleFilePath, *workers, filterOpt, *sortBy, *limit)
+}
 
-	// Create output directory if it doesn't exist
-	if _, err := os.Stat(*outputDir); os.IsNotExist(err) {
-		err = os.MkdirAll(*outputDir, 0755)
-		if err != nil {
-			fmt.Printf("Error creating output directory: %v\n", err)
-			os.Exit(1)
+// validSortKey reports whether key is one of pipeline.SortKeys.
+func validSortKey(key string) bool {
+	for _, k := range pipeline.SortKeys {
+		if key == k {
+			return true
 		}
-		fmt.Printf("Created output directory: %s\n", *outputDir)
+	}
+	return false
+}
+
+// runFetch pages through the thesession.org API for tunes matching params
+// and writes them out through the same pipeline writer path used for
+// local files, so -fetch and the default mode behave identically once
+// tunes start arriving.
+func runFetch(ctx context.Context, outputDir string, single bool, singleFile string, workers int, params fetch.Params, filterOpt filter.Expr, sortBy string, limit int) {
+	client := fetch.NewClient(fetch.DefaultCacheDir())
+
+	jobs := make(chan pipeline.Job)
+	searchErrCh := make(chan error, 1)
+
+	stopCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	go func() {
+		defer close(jobs)
+		seq := 0
+		searchErrCh <- client.Search(stopCtx, params, func(tune session.Tune) error {
+			select {
+			case jobs <- pipeline.Job{Seq: seq, Tune: tune}:
+			case <-stopCtx.Done():
+				return stopCtx.Err()
+			}
+			seq++
+			return nil
+		})
+	}()
+
+	cfg := pipeline.Config{
+		Workers:    workers,
+		OutputDir:  outputDir,
+		Single:     single,
+		SingleFile: singleFile,
+		Filter:     filterOpt,
+		Sort:       sortBy,
+		Limit:      limit,
+		Progress: func(n int) {
+			fmt.Printf("Fetched %d tunes...\n", n)
+		},
 	}
 
-	if *singleFile {
-		// Write all tunes to a single file
-		outputToSingleFile(tunes, *outputDir, *singleFilePath)
-	} else {
-		// Write each tune to a separate file
-		outputToMultipleFiles(tunes, *outputDir)
+	processed, writeErr := pipeline.Consume(ctx, stop, jobs, cfg)
+
+	searchErr := <-searchErrCh
+	if searchErr == context.Canceled {
+		searchErr = nil
+	}
+
+	if writeErr == context.Canceled {
+		fmt.Printf("Interrupted: flushed %d tunes before shutting down\n", processed)
+		return
 	}
+	if writeErr != nil {
+		fmt.Printf("Error: %v\n", writeErr)
+		os.Exit(1)
+	}
+	if searchErr != nil {
+		fmt.Printf("Error fetching tunes: %v\n", searchErr)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Successfully wrote %d tunes to %s\n", processed, outputDir)
 }
 
-func outputToSingleFile(tunes []Tune, outputDir, fileName string) {
-	outputPath := filepath.Join(outputDir, fileName)
-	f, err := os.Create(outputPath)
+// runForward streams tunes from inputFile through the pipeline package,
+// writing ABC output as either one file per tune or a single ordered file.
+func runForward(ctx context.Context, inputFile, outputDir string, single bool, singleFile string, workers int, filterOpt filter.Expr, sortBy string, limit int) {
+	if inputFile == "" {
+		fmt.Println("Please provide an input file with the -input flag")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	f, err := os.Open(inputFile)
 	if err != nil {
-		fmt.Printf("Error creating output file: %v\n", err)
+		fmt.Printf("Error opening file: %v\n", err)
 		os.Exit(1)
 	}
 	defer f.Close()
 
-	for _, tune := range tunes {
-		// Write the standard ABC header fields
-		fmt.Fprintf(f, "X:%s\n", tune.SettingID)
-		fmt.Fprintf(f, "T:%s\n", tune.Name)
-		fmt.Fprintf(f, "R:%s\n", tune.Type)
-		fmt.Fprintf(f, "M:%s\n", tune.Meter)
-		fmt.Fprintf(f, "K:%s\n", modeToBetter(tune.Mode))
-		if tune.Username != "" {
-			fmt.Fprintf(f, "Z:%s\n", tune.Username)
-		}
-		if tune.Date != "" {
-			fmt.Fprintf(f, "H:Added %s\n", tune.Date)
-		}
+	cfg := pipeline.Config{
+		Workers:    workers,
+		OutputDir:  outputDir,
+		Single:     single,
+		SingleFile: singleFile,
+		Filter:     filterOpt,
+		Sort:       sortBy,
+		Limit:      limit,
+		Progress: func(n int) {
+			fmt.Printf("Processed %d tunes...\n", n)
+		},
+	}
 
-		// Write the ABC notation
-		fmt.Fprintln(f, tune.ABC)
-		fmt.Fprintln(f, "") // Add a blank line between tunes
+	processed, err := pipeline.Run(ctx, f, cfg)
+	if err == context.Canceled {
+		fmt.Printf("Interrupted: flushed %d tunes before shutting down\n", processed)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	fmt.Printf("Successfully wrote %d tunes to %s\n", len(tunes), outputPath)
+	fmt.Printf("Successfully wrote %d tunes to %s\n", processed, outputDir)
 }
 
-func outputToMultipleFiles(tunes []Tune, outputDir string) {
-	processed := 0
-	
-	for i, tune := range tunes {
-		// Create a filename based on the tune's ID and name
-		safeName := sanitizeFileName(tune.Name)
-		fileName := fmt.Sprintf("%s_%s.abc", tune.SettingID, safeName)
-		outputPath := filepath.Join(outputDir, fileName)
-
-		// Ensure we create a new file for each tune
-		f, err := os.Create(outputPath)
+// runReverse reads one or more .abc files (either explicitly listed as
+// args, or the single file passed via -input) and writes the resulting
+// tunes out as a JSON array.
+func runReverse(inputFile string, args []string, outputDir, jsonOutName string) {
+	files := args
+	if len(files) == 0 && inputFile != "" {
+		files = []string{inputFile}
+	}
+	if len(files) == 0 {
+		fmt.Println("Please provide one or more .abc files with -input or as arguments")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	var tunes []session.Tune
+	for _, path := range files {
+		data, err := os.ReadFile(path)
 		if err != nil {
-			fmt.Printf("Error creating output file %s: %v\n", outputPath, err)
-			continue
+			fmt.Printf("Error reading file %s: %v\n", path, err)
+			os.Exit(1)
 		}
 
-		// Write the standard ABC header fields
-		fmt.Fprintf(f, "X:%s\n", tune.SettingID)
-		fmt.Fprintf(f, "T:%s\n", tune.Name)
-		fmt.Fprintf(f, "R:%s\n", tune.Type)
-		fmt.Fprintf(f, "M:%s\n", tune.Meter)
-		fmt.Fprintf(f, "K:%s\n", modeToBetter(tune.Mode))
-		if tune.Username != "" {
-			fmt.Fprintf(f, "Z:%s\n", tune.Username)
-		}
-		if tune.Date != "" {
-			fmt.Fprintf(f, "H:Added %s\n", tune.Date)
+		parsed, err := abc.ParseFile(data)
+		if err != nil {
+			fmt.Printf("Error parsing file %s: %v\n", path, err)
+			os.Exit(1)
 		}
 
-		// Write the ABC notation
-		fmt.Fprintln(f, tune.ABC)
-
-		// Make sure to close the file after writing
-		f.Close()
-		processed++
-
-		if (i+1)%100 == 0 {
-			fmt.Printf("Processed %d tunes...\n", i+1)
-		}
+		tunes = append(tunes, parsed...)
 	}
 
-	fmt.Printf("Successfully wrote %d tunes to individual files in %s\n", processed, outputDir)
-}
-
-// sanitizeFileName removes characters that are not allowed in filenames
-func sanitizeFileName(name string) string {
-	// Replace problematic characters with underscores
-	illegalChars := []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|"}
-	result := name
-
-	for _, char := range illegalChars {
-		result = strings.ReplaceAll(result, char, "_")
+	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			fmt.Printf("Error creating output directory: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
-	// Shorten length if needed
-	if len(result) > 50 {
-		result = result[:50]
+	outputPath := filepath.Join(outputDir, jsonOutName)
+	if err := session.SaveTunes(outputPath, tunes); err != nil {
+		fmt.Printf("Error writing JSON: %v\n", err)
+		os.Exit(1)
 	}
 
-	return result
-}
-
-// modeToBetter converts mode formats like "Gmajor" to "G" for ABC notation
-func modeToBetter(mode string) string {
-	// Handle common mode formats
-	mode = strings.ToLower(mode)
-	if strings.HasSuffix(mode, "major") {
-		return strings.TrimSuffix(mode, "major")
-	} else if strings.HasSuffix(mode, "minor") {
-		return strings.TrimSuffix(mode, "minor") + "m"
-	} else if strings.Contains(mode, "mixolydian") {
-		// For mixolydian modes, use K:D mix format
-		return strings.Replace(mode, "mixolydian", " mix", 1)
-	} else if strings.Contains(mode, "dorian") {
-		return strings.Replace(mode, "dorian", " dor", 1)
-	} else if strings.Contains(mode, "phrygian") {
-		return strings.Replace(mode, "phrygian", " phr", 1)
-	} else if strings.Contains(mode, "lydian") {
-		return strings.Replace(mode, "lydian", " lyd", 1)
-	} else if strings.Contains(mode, "locrian") {
-		return strings.Replace(mode, "locrian", " loc", 1)
-	}
-	
-	// Return as is if no known pattern
-	return mode
+	fmt.Printf("Successfully wrote %d tunes to %s\n", len(tunes), outputPath)
 }
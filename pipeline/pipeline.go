@@ -0,0 +1,414 @@
+// Package pipeline streams tunes out of a JSON array, one at a time, and
+// fans them out to a pool of worker goroutines that render and write ABC
+// output. It never holds the full input (or output) in memory at once,
+// which matters for dumps that run into the hundreds of megabytes.
+package pipeline
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CormacC30/json-abc-converter/abc"
+	"github.com/CormacC30/json-abc-converter/filter"
+	"github.com/CormacC30/json-abc-converter/session"
+)
+
+// SortKeys are the Tune fields accepted by Config.Sort.
+var SortKeys = []string{"name", "setting_id", "type"}
+
+// Job is a single tune read off the input stream, tagged with its
+// position in the stream so order can be reconstructed downstream.
+type Job struct {
+	Seq  int
+	Tune session.Tune
+}
+
+// Config controls the shape of the streaming pipeline.
+type Config struct {
+	Workers    int                 // number of concurrent render/write goroutines
+	QueueSize  int                 // buffered channel size between decode and workers; defaults to Workers*4
+	OutputDir  string              // directory written files are created in
+	Single     bool                // funnel output into one file instead of one file per tune
+	SingleFile string              // output filename when Single is set
+	Progress   func(processed int) // called periodically with the running total; may be nil
+
+	Filter filter.Expr // when set, tunes that don't match are dropped
+	Sort   string      // one of SortKeys; empty preserves input order
+	Limit  int         // when > 0, keep at most this many tunes (after Filter and Sort)
+}
+
+// Run decodes tunes from r one at a time and writes ABC output under
+// cfg.OutputDir, either one file per tune or funneled into a single file
+// with input order preserved. If ctx is canceled, Run stops pulling new
+// tunes but lets in-flight work finish writing before returning.
+func Run(ctx context.Context, r io.Reader, cfg Config) (int, error) {
+	jobs := make(chan Job, queueSize(cfg))
+
+	stopCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	decodeErrCh := make(chan error, 1)
+	go func() {
+		defer close(jobs)
+		decodeErrCh <- decode(stopCtx, r, jobs)
+	}()
+
+	processed, writeErr := Consume(ctx, stop, jobs, cfg)
+
+	decodeErr := <-decodeErrCh
+	if decodeErr == context.Canceled {
+		decodeErr = nil
+	}
+
+	if writeErr != nil {
+		return processed, writeErr
+	}
+	if decodeErr != nil {
+		return processed, decodeErr
+	}
+	return processed, ctx.Err()
+}
+
+// Consume writes tunes arriving on jobs as ABC output, either one file per
+// tune or funneled into a single ordered file. Callers that already have
+// their own source of tunes (e.g. the fetch package paging through an API)
+// feed jobs directly instead of going through Run's JSON decode step.
+//
+// stop is the cancel func for the context the caller's producer (decode,
+// or fetch's paginated search) is listening on. When cfg.Sort is unset,
+// Filter/Limit can be satisfied without seeing the whole input, and
+// Consume calls stop once Limit is reached so the producer quits early
+// instead of running to completion for jobs that would just be dropped.
+func Consume(ctx context.Context, stop context.CancelFunc, jobs <-chan Job, cfg Config) (int, error) {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = queueSize(cfg)
+	}
+
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return 0, fmt.Errorf("creating output directory: %w", err)
+	}
+
+	switch {
+	case cfg.Sort != "":
+		jobs = arrange(jobs, cfg)
+	case cfg.Filter != nil || cfg.Limit > 0:
+		jobs = streamArrange(jobs, cfg, stop)
+	}
+
+	var processed int64
+
+	progressDone := make(chan struct{})
+	if cfg.Progress != nil {
+		go reportProgress(&processed, progressDone, cfg.Progress)
+	}
+	defer close(progressDone)
+
+	var writeErr error
+	if cfg.Single {
+		writeErr = runSingleWriter(jobs, cfg, &processed)
+	} else {
+		writeErr = runMultiWriters(jobs, cfg, &processed)
+	}
+
+	if writeErr != nil {
+		return int(processed), writeErr
+	}
+	return int(processed), ctx.Err()
+}
+
+// queueSize returns cfg.QueueSize, defaulting to four times the worker
+// count when unset.
+func queueSize(cfg Config) int {
+	if cfg.QueueSize > 0 {
+		return cfg.QueueSize
+	}
+	if cfg.Workers > 0 {
+		return cfg.Workers * 4
+	}
+	return 4
+}
+
+// decode reads the opening '[' of a JSON tune array and pushes one Job per
+// element onto jobs, blocking (providing backpressure) when the channel is
+// full. It stops early, without error beyond ctx.Err(), if ctx is canceled.
+func decode(ctx context.Context, r io.Reader, jobs chan<- Job) error {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("reading opening token: %w", err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected a JSON array, got %v", tok)
+	}
+
+	seq := 0
+	for dec.More() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		var tune session.Tune
+		if err := dec.Decode(&tune); err != nil {
+			return fmt.Errorf("decoding tune %d: %w", seq, err)
+		}
+
+		select {
+		case jobs <- Job{Seq: seq, Tune: tune}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		seq++
+	}
+
+	return nil
+}
+
+// arrange applies cfg.Filter, cfg.Sort and cfg.Limit to jobs arriving on
+// in, returning a new channel that is already closed by the time it's
+// handed back. Sorting needs to see every tune before it can emit the
+// first one, so unlike the rest of this package, arrange necessarily
+// buffers the whole (filtered) result set in memory before any
+// rendering or writing starts. Only called when cfg.Sort is set; the
+// Sort-less case is handled by streamArrange instead, which doesn't
+// need this buffering.
+func arrange(in <-chan Job, cfg Config) <-chan Job {
+	var jobs []Job
+	for job := range in {
+		if cfg.Filter != nil && !cfg.Filter.Eval(job.Tune) {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	sortJobs(jobs, cfg.Sort)
+
+	if cfg.Limit > 0 && len(jobs) > cfg.Limit {
+		jobs = jobs[:cfg.Limit]
+	}
+
+	out := make(chan Job, len(jobs))
+	for i, job := range jobs {
+		job.Seq = i
+		out <- job
+	}
+	close(out)
+	return out
+}
+
+// streamArrange applies cfg.Filter and cfg.Limit to jobs arriving on in,
+// one at a time, re-numbering Seq as it goes. Unlike arrange, it never
+// buffers more than the job currently in flight: once Limit matches have
+// been emitted it calls stop and returns without draining the rest of
+// in, so a paginated or large input stops producing as soon as enough
+// tunes have been found instead of running to completion first.
+func streamArrange(in <-chan Job, cfg Config, stop context.CancelFunc) <-chan Job {
+	out := make(chan Job, cfg.QueueSize)
+	go func() {
+		defer close(out)
+		seq := 0
+		for job := range in {
+			if cfg.Filter != nil && !cfg.Filter.Eval(job.Tune) {
+				continue
+			}
+			job.Seq = seq
+			out <- job
+			seq++
+			if cfg.Limit > 0 && seq >= cfg.Limit {
+				stop()
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// sortJobs sorts jobs in place by the named Tune field. An empty key
+// leaves jobs in their filtered input order.
+func sortJobs(jobs []Job, key string) {
+	var less func(a, b session.Tune) bool
+	switch key {
+	case "":
+		return
+	case "name":
+		less = func(a, b session.Tune) bool { return a.Name < b.Name }
+	case "setting_id":
+		less = func(a, b session.Tune) bool { return a.SettingID < b.SettingID }
+	case "type":
+		less = func(a, b session.Tune) bool { return a.Type < b.Type }
+	default:
+		return
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool { return less(jobs[i].Tune, jobs[j].Tune) })
+}
+
+// render renders a single tune to its ABC representation.
+func render(tune session.Tune) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := abc.WriteTune(&buf, tune); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// runMultiWriters has cfg.Workers goroutines each pull jobs and write one
+// .abc file per tune; because each tune lands in its own file, no
+// reordering is needed.
+func runMultiWriters(jobs <-chan Job, cfg Config, processed *int64) error {
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for i := 0; i < cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				data, err := render(job.Tune)
+				if err != nil {
+					once.Do(func() { firstErr = fmt.Errorf("rendering tune %s: %w", job.Tune.SettingID, err) })
+					continue
+				}
+
+				name := fmt.Sprintf("%s_%s.abc", job.Tune.SettingID, abc.SanitizeFileName(job.Tune.Name))
+				path := filepath.Join(cfg.OutputDir, name)
+				if err := os.WriteFile(path, data, 0644); err != nil {
+					once.Do(func() { firstErr = fmt.Errorf("writing %s: %w", path, err) })
+					continue
+				}
+
+				atomic.AddInt64(processed, 1)
+			}
+		}()
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// renderedJob is a tune that has been rendered to ABC text but not yet
+// written, still carrying its original sequence number. Err is set
+// instead of Data when rendering that tune failed, so the writer's
+// reorder heap still sees the Seq arrive and doesn't stall waiting for a
+// slot that will never be filled.
+type renderedJob struct {
+	Seq  int
+	Data []byte
+	Err  error
+}
+
+// runSingleWriter has cfg.Workers goroutines render tunes concurrently,
+// then funnels the results through one writer goroutine that uses a
+// min-heap to buffer out-of-order results until it can write them back in
+// the original input order.
+func runSingleWriter(jobs <-chan Job, cfg Config, processed *int64) error {
+	results := make(chan renderedJob, cfg.QueueSize)
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				data, err := render(job.Tune)
+				if err != nil {
+					results <- renderedJob{Seq: job.Seq, Err: fmt.Errorf("rendering tune %s: %w", job.Tune.SettingID, err)}
+					continue
+				}
+				results <- renderedJob{Seq: job.Seq, Data: data}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	path := filepath.Join(cfg.OutputDir, cfg.SingleFile)
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	defer f.Close()
+
+	pending := &renderedHeap{}
+	heap.Init(pending)
+	next := 0
+	var firstErr error
+
+	for result := range results {
+		heap.Push(pending, result)
+
+		for pending.Len() > 0 && (*pending)[0].Seq == next {
+			item := heap.Pop(pending).(renderedJob)
+			next++
+
+			if item.Err != nil {
+				if firstErr == nil {
+					firstErr = item.Err
+				}
+				continue
+			}
+			if _, err := f.Write(item.Data); err != nil {
+				return fmt.Errorf("writing output: %w", err)
+			}
+			if _, err := f.WriteString("\n"); err != nil {
+				return fmt.Errorf("writing output: %w", err)
+			}
+			atomic.AddInt64(processed, 1)
+		}
+	}
+
+	return firstErr
+}
+
+// renderedHeap orders renderedJobs by sequence number so the single writer
+// can reassemble them in input order regardless of render completion order.
+type renderedHeap []renderedJob
+
+func (h renderedHeap) Len() int            { return len(h) }
+func (h renderedHeap) Less(i, j int) bool  { return h[i].Seq < h[j].Seq }
+func (h renderedHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *renderedHeap) Push(x interface{}) { *h = append(*h, x.(renderedJob)) }
+func (h *renderedHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// reportProgress calls fn once a second (and once more on shutdown) with
+// the current processed count, decoupled from the write path so slow
+// writers don't delay progress output.
+func reportProgress(counter *int64, done <-chan struct{}, fn func(int)) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fn(int(atomic.LoadInt64(counter)))
+		case <-done:
+			fn(int(atomic.LoadInt64(counter)))
+			return
+		}
+	}
+}
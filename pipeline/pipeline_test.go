@@ -0,0 +1,174 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CormacC30/json-abc-converter/filter"
+)
+
+const testTunesJSON = `[
+	{"tune_id":"1","setting_id":"1","name":"Tune One","type":"reel","meter":"4/4","mode":"Gmajor","abc":"abc one"},
+	{"tune_id":"2","setting_id":"2","name":"Tune Two","type":"jig","meter":"6/8","mode":"Dmajor","abc":"abc two"},
+	{"tune_id":"3","setting_id":"3","name":"Tune Three","type":"reel","meter":"4/4","mode":"Aminor","abc":"abc three"}
+]`
+
+func TestRunMultiWriters(t *testing.T) {
+	dir := t.TempDir()
+
+	processed, err := Run(context.Background(), strings.NewReader(testTunesJSON), Config{
+		Workers:   2,
+		OutputDir: dir,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if processed != 3 {
+		t.Fatalf("processed = %d, want 3", processed)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d output files, want 3", len(entries))
+	}
+}
+
+func TestRunMultiWritersReturnsOnSustainedWriteErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	var tunes []string
+	for i := 0; i < 20; i++ {
+		tunes = append(tunes, `{"tune_id":"1","setting_id":"missing/dir","name":"Tune","type":"reel","meter":"4/4","mode":"Gmajor","abc":"abc"}`)
+	}
+	badTunesJSON := "[" + strings.Join(tunes, ",") + "]"
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Run(context.Background(), strings.NewReader(badTunesJSON), Config{
+			Workers:   2,
+			OutputDir: dir,
+		})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Run: want an error from writes under a missing subdirectory, got nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return within 5s; want it to report the first write error instead of hanging")
+	}
+}
+
+func TestRunSingleWriterPreservesOrder(t *testing.T) {
+	dir := t.TempDir()
+
+	processed, err := Run(context.Background(), strings.NewReader(testTunesJSON), Config{
+		Workers:    4,
+		OutputDir:  dir,
+		Single:     true,
+		SingleFile: "all.abc",
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if processed != 3 {
+		t.Fatalf("processed = %d, want 3", processed)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "all.abc"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	firstIdx := strings.Index(string(data), "X:1")
+	secondIdx := strings.Index(string(data), "X:2")
+	thirdIdx := strings.Index(string(data), "X:3")
+	if !(firstIdx >= 0 && firstIdx < secondIdx && secondIdx < thirdIdx) {
+		t.Fatalf("output not in input order:\n%s", data)
+	}
+}
+
+// countingReader counts the bytes Read has returned, so a test can check
+// whether a Limit-only run stopped decoding early instead of reading the
+// whole input.
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestRunLimitWithoutSortStopsEarly(t *testing.T) {
+	dir := t.TempDir()
+
+	var tunes []string
+	for i := 0; i < 50; i++ {
+		tunes = append(tunes, `{"tune_id":"1","setting_id":"1","name":"Tune","type":"reel","meter":"4/4","mode":"Gmajor","abc":"abc"}`)
+	}
+	manyTunesJSON := "[" + strings.Join(tunes, ",") + "]"
+
+	cr := &countingReader{r: strings.NewReader(manyTunesJSON)}
+
+	processed, err := Run(context.Background(), cr, Config{
+		Workers:   1,
+		QueueSize: 1,
+		OutputDir: dir,
+		Limit:     1,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if processed != 1 {
+		t.Fatalf("processed = %d, want 1", processed)
+	}
+	if cr.read >= len(manyTunesJSON) {
+		t.Fatalf("read %d of %d bytes, want decoding to stop well before the end once Limit was reached", cr.read, len(manyTunesJSON))
+	}
+}
+
+func TestRunFilterSortLimit(t *testing.T) {
+	dir := t.TempDir()
+
+	expr, err := filter.Parse("type=reel")
+	if err != nil {
+		t.Fatalf("filter.Parse: %v", err)
+	}
+
+	processed, err := Run(context.Background(), strings.NewReader(testTunesJSON), Config{
+		Workers:    2,
+		OutputDir:  dir,
+		Single:     true,
+		SingleFile: "all.abc",
+		Filter:     expr,
+		Sort:       "name",
+		Limit:      1,
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if processed != 1 {
+		t.Fatalf("processed = %d, want 1", processed)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "all.abc"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(data), "T:Tune One") {
+		t.Fatalf("expected the alphabetically first matching reel, got:\n%s", data)
+	}
+}
@@ -0,0 +1,52 @@
+// Package session defines the Tune model shared across the converter's
+// input and output paths, along with helpers for reading and writing the
+// thesession.org-style JSON representation.
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Tune represents the structure of each tune in the JSON file.
+type Tune struct {
+	TuneID    string `json:"tune_id"`
+	SettingID string `json:"setting_id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Meter     string `json:"meter"`
+	Mode      string `json:"mode"`
+	ABC       string `json:"abc"`
+	Date      string `json:"date,omitempty"`
+	Username  string `json:"username,omitempty"`
+}
+
+// LoadTunes reads and parses a JSON file containing an array of tunes.
+func LoadTunes(path string) ([]Tune, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+
+	var tunes []Tune
+	if err := json.Unmarshal(data, &tunes); err != nil {
+		return nil, fmt.Errorf("parsing JSON: %w", err)
+	}
+
+	return tunes, nil
+}
+
+// SaveTunes writes tunes as a formatted JSON array to path.
+func SaveTunes(path string, tunes []Tune) error {
+	data, err := json.MarshalIndent(tunes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding JSON: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing file: %w", err)
+	}
+
+	return nil
+}